@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"strconv"
+
+	"github.com/mjtrangoni/openldap_exporter/sources"
+)
+
+//defaultEnabledCollectors lists the sources that are active out of the box.
+//There currently are none: every source in sources.Factories needs at least
+//a target URL, so it must be turned on explicitly with --collector.<name>.
+var defaultEnabledCollectors = map[string]bool{}
+
+//enableFlag and disableFlag implement flag.Value and share a single *bool
+//so that --collector.<name> and --no-collector.<name> can each be bound to
+//it, following the node_exporter convention for toggling collectors.
+type enableFlag struct{ enabled *bool }
+
+func (f enableFlag) String() string {
+	if f.enabled == nil {
+		return "false"
+	}
+	return strconv.FormatBool(*f.enabled)
+}
+
+func (f enableFlag) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*f.enabled = v
+	return nil
+}
+
+func (f enableFlag) IsBoolFlag() bool { return true }
+
+type disableFlag struct{ enabled *bool }
+
+func (f disableFlag) String() string {
+	if f.enabled == nil {
+		return "true"
+	}
+	return strconv.FormatBool(!*f.enabled)
+}
+
+func (f disableFlag) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*f.enabled = !v
+	return nil
+}
+
+func (f disableFlag) IsBoolFlag() bool { return true }
+
+//collectorFlags registers a --collector.<name>/--no-collector.<name> pair
+//for every source in sources.Factories and returns the map of booleans
+//they control, keyed by source name.
+func collectorFlags() map[string]*bool {
+	names := make([]string, 0, len(sources.Factories))
+	for name := range sources.Factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	enabled := make(map[string]*bool, len(names))
+	for _, name := range names {
+		e := defaultEnabledCollectors[name]
+		enabled[name] = &e
+		flag.Var(enableFlag{&e}, "collector."+name, "Enable the "+name+" collector.")
+		flag.Var(disableFlag{&e}, "no-collector."+name, "Disable the "+name+" collector.")
+	}
+	return enabled
+}
+
+//enabledCollectorNames returns the sorted names of collectors whose flag is
+//currently set.
+func enabledCollectorNames(enabled map[string]*bool) []string {
+	names := make([]string, 0, len(enabled))
+	for name, e := range enabled {
+		if *e {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/mjtrangoni/openldap_exporter/sources"
+	"github.com/prometheus/client_golang/prometheus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+//Config is the document loaded from --config.file. It gathers the sources
+//enabled for /metrics, the default scrape timeout, and the named
+//credential/TLS modules /probe requests can select. The ldap/syncrepl
+//sources scraped by /metrics still take their target URL and credentials
+//from the ldap.*/syncrepl.* flags: config.file only chooses which of the
+//sources already configured by flag are enabled, it does not itself carry
+//LDAP targets.
+type Config struct {
+	EnabledSources []string               `yaml:"enabled_sources"`
+	ScrapeTimeout  time.Duration          `yaml:"scrape_timeout"`
+	Modules        map[string]probeModule `yaml:"modules"`
+}
+
+var (
+	configLastReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: sources.Namespace,
+		Subsystem: "exporter",
+		Name:      "config_last_reload_success",
+		Help:      "Whether the last configuration reload attempt was successful.",
+	})
+	configLastReloadSuccessSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: sources.Namespace,
+		Subsystem: "exporter",
+		Name:      "config_last_reload_success_seconds",
+		Help:      "Unix timestamp of the last successful configuration reload.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(configLastReloadSuccess, configLastReloadSuccessSeconds)
+}
+
+//safeConfig guards a *Config behind a RWMutex so that a reload can swap it
+//out while scrapes are reading it concurrently.
+type safeConfig struct {
+	mu sync.RWMutex
+	c  *Config
+}
+
+//Get returns the currently active configuration.
+func (sc *safeConfig) Get() *Config {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.c
+}
+
+//ReloadConfig parses path and, if valid, swaps it in as the active
+//configuration. On failure the previous configuration is left in place and
+//an error is returned for the caller to log.
+func (sc *safeConfig) ReloadConfig(path string) error {
+	cfg, err := loadConfigFile(path)
+	if err != nil {
+		configLastReloadSuccess.Set(0)
+		return err
+	}
+
+	sc.mu.Lock()
+	sc.c = cfg
+	sc.mu.Unlock()
+
+	configLastReloadSuccess.Set(1)
+	configLastReloadSuccessSeconds.SetToCurrentTime()
+	return nil
+}
+
+//loadConfigFile reads and validates the YAML document at path.
+func loadConfigFile(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config.file: %s", err)
+	}
+
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse config.file: %s", err)
+	}
+
+	for _, name := range cfg.EnabledSources {
+		if _, ok := sources.Factories[name]; !ok {
+			return nil, fmt.Errorf("config.file: enabled_sources: source %q not available", name)
+		}
+	}
+
+	return cfg, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"net/http"
@@ -28,8 +29,12 @@ var (
 )
 
 //OpenLDAPSource is a list of all sources that the user would like to collect.
+//sourceList is a func rather than a plain map so that the long-lived
+//collector registered for /metrics can be re-pointed at a rebuilt source
+//list on every scrape, e.g. after enabled_sources changes on config.file
+//reload, without ever needing to be unregistered and re-registered.
 type OpenLDAPSource struct {
-	sourceList map[string]sources.OpenLDAPSource
+	sourceList func() map[string]sources.OpenLDAPSource
 }
 
 //Describe implements the prometheus.Describe interface
@@ -39,9 +44,10 @@ func (l OpenLDAPSource) Describe(ch chan<- *prometheus.Desc) {
 
 //Collect implements the prometheus.Collect interface
 func (l OpenLDAPSource) Collect(ch chan<- prometheus.Metric) {
+	sourceList := l.sourceList()
 	wg := sync.WaitGroup{}
-	wg.Add(len(l.sourceList))
-	for name, c := range l.sourceList {
+	wg.Add(len(sourceList))
+	for name, c := range sourceList {
 		go func(name string, c sources.OpenLDAPSource) {
 			collectFromSource(name, c, ch)
 			wg.Done()
@@ -51,6 +57,28 @@ func (l OpenLDAPSource) Collect(ch chan<- prometheus.Metric) {
 	scrapeDurations.Collect(ch)
 }
 
+//sourceListHolder guards the map of active sources behind a RWMutex, so that
+//reloadConfig can swap in a rebuilt map (following an enabled_sources change
+//in config.file) while a scrape is concurrently reading the current one.
+type sourceListHolder struct {
+	mu sync.RWMutex
+	m  map[string]sources.OpenLDAPSource
+}
+
+//Get returns the currently active source list.
+func (h *sourceListHolder) Get() map[string]sources.OpenLDAPSource {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.m
+}
+
+//Set replaces the active source list.
+func (h *sourceListHolder) Set(m map[string]sources.OpenLDAPSource) {
+	h.mu.Lock()
+	h.m = m
+	h.mu.Unlock()
+}
+
 func collectFromSource(name string, s sources.OpenLDAPSource, ch chan<- prometheus.Metric) {
 	result := "success"
 	begin := time.Now()
@@ -85,12 +113,50 @@ func init() {
 	prometheus.MustRegister(version.NewCollector("openldap_exporter"))
 }
 
+//newMetricsHandler registers holder against the default registry and
+//returns a handler that serves it as-is, except when the request carries
+//one or more collect[] query parameters: then a throwaway registry holding
+//only the requested sources is built and served instead, so a single scrape
+//can narrow the active sources without affecting any other scrape. Because
+//holder is read fresh on every Collect, an enabled_sources change applied
+//via config.file reload takes effect on the very next scrape.
+func newMetricsHandler(holder *sourceListHolder) http.HandlerFunc {
+	prometheus.MustRegister(OpenLDAPSource{sourceList: holder.Get})
+	defaultHandler := promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{ErrorLog: log.NewErrorLogger()})
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter := r.URL.Query()["collect[]"]
+		if len(filter) == 0 {
+			defaultHandler.ServeHTTP(w, r)
+			return
+		}
+
+		sourceList := holder.Get()
+		filtered := map[string]sources.OpenLDAPSource{}
+		for _, name := range filter {
+			if s, ok := sourceList[name]; ok {
+				filtered[name] = s
+			}
+		}
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(version.NewCollector("openldap_exporter"))
+		registry.MustRegister(OpenLDAPSource{sourceList: func() map[string]sources.OpenLDAPSource { return filtered }})
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorLog: log.NewErrorLogger()}).ServeHTTP(w, r)
+	}
+}
+
 func main() {
 	var (
-		showVersion   = flag.Bool("version", false, "Print version information.")
-		listenAddress = flag.String("web.listen-address", ":9999", "Address to use to expose OpenLDAP metrics.")
-		metricsPath   = flag.String("web.telemetry-path", "/metrics", "Path to use to expose OpenLDAP metrics.")
+		showVersion      = flag.Bool("version", false, "Print version information.")
+		listenAddress    = flag.String("web.listen-address", ":9999", "Address to use to expose OpenLDAP metrics.")
+		metricsPath      = flag.String("web.telemetry-path", "/metrics", "Path to use to expose OpenLDAP metrics.")
+		probeModulesFile = flag.String("probe.modules-config", "", "YAML file defining named credential/TLS profiles selectable via /probe?module=. Ignored when config.file is set.")
+		probeTimeout     = flag.Duration("probe.timeout", 5*time.Second, "Default timeout for a /probe request when the module doesn't set its own. With config.file set, used only when it has no scrape_timeout.")
+		configFile       = flag.String("config.file", "", "YAML file defining enabled sources, scrape timeout and probe modules. Replaces probe.modules-config; its enabled_sources and scrape_timeout, when set, override the collector and probe.timeout flags. Hot-reloaded on SIGHUP or file change.")
+		webConfigFile    = flag.String("web.config.file", "", "YAML file enabling TLS/mTLS and HTTP basic auth on the exporter's own endpoint. No file means plain, unauthenticated HTTP, as before.")
 	)
+	enabledCollectors := collectorFlags()
 	flag.Parse()
 
 	if *showVersion {
@@ -101,8 +167,35 @@ func main() {
 	log.Infoln("Starting openldap_exporter", version.Info())
 	log.Infoln("Build context", version.BuildContext())
 
-	//expand to include more sources eventually (CLI, other?)
-	enabledSources := []string{"procfs"}
+	defaultSources := enabledCollectorNames(enabledCollectors)
+	enabledSources := defaultSources
+	var probeGetConfig probeConfigFunc
+	var sc *safeConfig
+
+	if *configFile != "" {
+		sc = &safeConfig{}
+		if err := sc.ReloadConfig(*configFile); err != nil {
+			log.Fatalf("Error loading config.file: %s", err)
+		}
+
+		if len(sc.Get().EnabledSources) > 0 {
+			enabledSources = sc.Get().EnabledSources
+		}
+		probeGetConfig = func() (map[string]probeModule, time.Duration) {
+			c := sc.Get()
+			timeout := c.ScrapeTimeout
+			if timeout == 0 {
+				timeout = *probeTimeout
+			}
+			return c.Modules, timeout
+		}
+	} else {
+		probeModules, err := loadProbeModules(*probeModulesFile)
+		if err != nil {
+			log.Fatalf("Couldn't load probe modules: %s", err)
+		}
+		probeGetConfig = staticProbeConfig(probeModules, *probeTimeout)
+	}
 
 	sourceList, err := loadSources(enabledSources)
 	if err != nil {
@@ -114,11 +207,22 @@ func main() {
 		log.Infof(" - %s", s)
 	}
 
-	prometheus.MustRegister(OpenLDAPSource{sourceList: sourceList})
-	handler := promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{ErrorLog: log.NewErrorLogger()})
+	holder := &sourceListHolder{}
+	holder.Set(sourceList)
+
+	if sc != nil {
+		watchConfig(sc, *configFile, holder, defaultSources)
+	}
+
+	webCfg, err := loadWebConfig(*webConfigFile)
+	if err != nil {
+		log.Fatalf("Error loading web.config.file: %s", err)
+	}
 
-	http.Handle(*metricsPath, prometheus.InstrumentHandler("prometheus", handler))
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	mux := http.NewServeMux()
+	mux.Handle(*metricsPath, prometheus.InstrumentHandler("prometheus", newMetricsHandler(holder)))
+	mux.HandleFunc("/probe", newProbeHandler(probeGetConfig))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
 			<head><title>OpenLDAP Exporter</title></head>
 			<body>
@@ -128,8 +232,31 @@ func main() {
 			</html>`))
 	})
 
+	var handler http.Handler = mux
+	var tlsConfig *tls.Config
+	if webCfg != nil {
+		handler = basicAuth(mux, webCfg.BasicAuthUsers)
+		tlsConfig, err = webCfg.TLSServerConfig.tlsConfig()
+		if err != nil {
+			log.Fatalf("Error configuring web.config.file TLS: %s", err)
+		}
+	}
+
+	server := &http.Server{
+		Addr:         *listenAddress,
+		Handler:      handler,
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+
 	log.Infoln("Listening on", *listenAddress)
-	err = http.ListenAndServe(*listenAddress, nil)
+	if tlsConfig != nil {
+		err = server.ListenAndServeTLS(webCfg.TLSServerConfig.CertFile, webCfg.TLSServerConfig.KeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
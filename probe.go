@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/mjtrangoni/openldap_exporter/sources"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/log"
+	yaml "gopkg.in/yaml.v2"
+)
+
+//probeModule describes the credentials and TLS settings a /probe request
+//may select by name via the "module" query parameter.
+type probeModule struct {
+	BindDN       string        `yaml:"bind_dn"`
+	BindPassword string        `yaml:"bind_password"`
+	StartTLS     bool          `yaml:"start_tls"`
+	TLSCAFile    string        `yaml:"tls_ca_file"`
+	TLSCertFile  string        `yaml:"tls_cert_file"`
+	TLSKeyFile   string        `yaml:"tls_key_file"`
+	Timeout      time.Duration `yaml:"timeout"`
+}
+
+//probeModulesConfig is the document loaded from --probe.modules-config.
+type probeModulesConfig struct {
+	Modules map[string]probeModule `yaml:"modules"`
+}
+
+//loadProbeModules reads the named YAML file and returns its modules. An
+//empty path is not an error: it simply means no named modules are
+//available and every /probe request must rely on the defaults.
+func loadProbeModules(path string) (map[string]probeModule, error) {
+	if path == "" {
+		return map[string]probeModule{}, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read probe.modules-config: %s", err)
+	}
+	var cfg probeModulesConfig
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse probe.modules-config: %s", err)
+	}
+	return cfg.Modules, nil
+}
+
+//probeResultCollector replays a fixed slice of metrics gathered by an
+//earlier call to OpenLDAPSource.Update.
+type probeResultCollector struct {
+	metrics []prometheus.Metric
+}
+
+//Describe implements the prometheus.Collector interface
+func (c probeResultCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+//Collect implements the prometheus.Collector interface
+func (c probeResultCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.metrics {
+		ch <- m
+	}
+}
+
+//probeConfigFunc returns the currently active probe modules and default
+//timeout. It is called once per request so that a config.file reload takes
+//effect on the very next scrape without restarting the handler.
+type probeConfigFunc func() (modules map[string]probeModule, defaultTimeout time.Duration)
+
+//staticProbeConfig returns a probeConfigFunc that always returns the same
+//modules and timeout, for use when no --config.file is set.
+func staticProbeConfig(modules map[string]probeModule, defaultTimeout time.Duration) probeConfigFunc {
+	return func() (map[string]probeModule, time.Duration) {
+		return modules, defaultTimeout
+	}
+}
+
+//newProbeHandler returns an http.HandlerFunc implementing the Prometheus
+//"multi-target exporter" pattern used by blackbox_exporter and friends:
+//each request scrapes the LDAP server named by the "target" query
+//parameter, optionally using the credential/TLS profile named by the
+//"module" parameter, and returns a fresh set of metrics scoped to that
+//single target.
+func newProbeHandler(getConfig probeConfigFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+			return
+		}
+
+		modules, defaultTimeout := getConfig()
+		mod := probeModule{Timeout: defaultTimeout}
+		if name := r.URL.Query().Get("module"); name != "" {
+			m, ok := modules[name]
+			if !ok {
+				http.Error(w, fmt.Sprintf("unknown module %q", name), http.StatusBadRequest)
+				return
+			}
+			mod = m
+			if mod.Timeout == 0 {
+				mod.Timeout = defaultTimeout
+			}
+		}
+
+		source, err := sources.NewLDAPSource(sources.LDAPOptions{
+			URL:          target,
+			BindDN:       mod.BindDN,
+			BindPassword: mod.BindPassword,
+			StartTLS:     mod.StartTLS,
+			TLSCAFile:    mod.TLSCAFile,
+			TLSCertFile:  mod.TLSCertFile,
+			TLSKeyFile:   mod.TLSKeyFile,
+			Timeout:      mod.Timeout,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		metricCh := make(chan prometheus.Metric)
+		var updateErr error
+		begin := time.Now()
+		go func() {
+			updateErr = source.Update(metricCh)
+			close(metricCh)
+		}()
+
+		metrics := make([]prometheus.Metric, 0, 64)
+		for m := range metricCh {
+			metrics = append(metrics, m)
+		}
+		duration := time.Since(begin)
+
+		probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "openldap_probe_success",
+			Help: "Whether the probe of the target succeeded.",
+		})
+		probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "openldap_probe_duration_seconds",
+			Help: "How long the probe of the target took in seconds.",
+		})
+		if updateErr != nil {
+			log.Errorf("probe of %q failed: %s", target, updateErr)
+			probeSuccess.Set(0)
+		} else {
+			probeSuccess.Set(1)
+		}
+		probeDuration.Set(duration.Seconds())
+
+		registry := prometheus.NewRegistry()
+		wrapped := prometheus.WrapRegistererWith(prometheus.Labels{"target": target}, registry)
+		wrapped.MustRegister(probeResultCollector{metrics: metrics}, probeSuccess, probeDuration)
+
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorLog: log.NewErrorLogger()}).ServeHTTP(w, r)
+	}
+}
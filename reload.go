@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/common/log"
+)
+
+//watchConfig reloads sc from path whenever the process receives SIGHUP or
+//an fsnotify watch on path's directory reports the file changed, following
+//the config reload pattern used by mysqld_exporter and Prometheus itself.
+//Watcher setup failures are logged, not fatal: SIGHUP reloading still
+//works even if the filesystem watch could not be established. holder is
+//re-pointed at the sources named by the new enabled_sources (or
+//defaultSources, if the reloaded config doesn't set any) so that a config
+//change takes effect on the next scrape without restarting the exporter.
+func watchConfig(sc *safeConfig, path string, holder *sourceListHolder, defaultSources []string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var events <-chan fsnotify.Event
+	var watchErrs <-chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Errorf("Unable to start config.file watcher: %s", err)
+	} else if err := watcher.Add(filepath.Dir(path)); err != nil {
+		log.Errorf("Unable to watch %s for changes: %s", filepath.Dir(path), err)
+		watcher.Close()
+	} else {
+		events = watcher.Events
+		watchErrs = watcher.Errors
+	}
+
+	go func() {
+		for {
+			select {
+			case <-hup:
+				reloadConfig(sc, path, holder, defaultSources)
+			case event, ok := <-events:
+				if !ok {
+					events = nil
+					continue
+				}
+				if filepath.Clean(event.Name) == filepath.Clean(path) {
+					reloadConfig(sc, path, holder, defaultSources)
+				}
+			case err, ok := <-watchErrs:
+				if !ok {
+					watchErrs = nil
+					continue
+				}
+				log.Errorf("config.file watcher error: %s", err)
+			}
+		}
+	}()
+}
+
+func reloadConfig(sc *safeConfig, path string, holder *sourceListHolder, defaultSources []string) {
+	if err := sc.ReloadConfig(path); err != nil {
+		log.Errorf("Error reloading config.file: %s", err)
+		return
+	}
+
+	enabledSources := defaultSources
+	if len(sc.Get().EnabledSources) > 0 {
+		enabledSources = sc.Get().EnabledSources
+	}
+	sourceList, err := loadSources(enabledSources)
+	if err != nil {
+		log.Errorf("Error reloading config.file: enabled_sources: %s", err)
+		return
+	}
+	holder.Set(sourceList)
+
+	log.Infoln("Reloaded config.file")
+}
@@ -0,0 +1,406 @@
+package sources
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/ldap.v3"
+)
+
+//monitorBaseDN is the root of the cn=Monitor subtree exposed by slapd's
+//back-monitor backend.
+const monitorBaseDN = "cn=Monitor"
+
+var (
+	ldapURL          = flag.String("ldap.url", "", "URL of the OpenLDAP server to scrape, e.g. ldap://localhost:389.")
+	ldapBindDN       = flag.String("ldap.bind-dn", "", "DN to bind with. Leave empty for an anonymous bind.")
+	ldapBindPassword = flag.String("ldap.bind-password", "", "Password to bind with.")
+	ldapBindPwFile   = flag.String("ldap.bind-password-file", "", "File containing the password to bind with. Takes precedence over ldap.bind-password.")
+	ldapStartTLS     = flag.Bool("ldap.start-tls", false, "Use StartTLS when connecting to ldap.url.")
+	ldapTLSCAFile    = flag.String("ldap.tls-ca-file", "", "PEM encoded CA certificate file used to verify the server certificate.")
+	ldapTLSCertFile  = flag.String("ldap.tls-cert-file", "", "PEM encoded certificate file for client certificate authentication.")
+	ldapTLSKeyFile   = flag.String("ldap.tls-key-file", "", "PEM encoded key file for client certificate authentication.")
+	ldapTimeout      = flag.Duration("ldap.timeout", 5*time.Second, "Timeout for LDAP connections and searches.")
+)
+
+func init() {
+	Factories["ldap"] = newLDAPSourceFromFlags
+}
+
+//LDAPOptions configures how an LDAPSource connects to and authenticates
+//against a remote slapd instance.
+type LDAPOptions struct {
+	URL          string
+	BindDN       string
+	BindPassword string
+	StartTLS     bool
+	TLSCAFile    string
+	TLSCertFile  string
+	TLSKeyFile   string
+	Timeout      time.Duration
+}
+
+//LDAPSource scrapes the cn=Monitor subtree of a remote OpenLDAP server and
+//translates it into Prometheus metrics. Unlike ProcfsSource, it does not
+//require the exporter to run on the same host as slapd.
+type LDAPSource struct {
+	opts LDAPOptions
+}
+
+//NewLDAPSource returns an OpenLDAPSource that scrapes the slapd instance
+//described by opts.
+func NewLDAPSource(opts LDAPOptions) (OpenLDAPSource, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("ldap: no URL configured")
+	}
+	return &LDAPSource{opts: opts}, nil
+}
+
+//newLDAPSourceFromFlags builds an LDAPSource from the ldap.* flags. It
+//backs the "ldap" entry in Factories so the collector can be enabled with
+//--collector.ldap once ldap.url is set.
+func newLDAPSourceFromFlags() (OpenLDAPSource, error) {
+	bindPassword := *ldapBindPassword
+	if *ldapBindPwFile != "" {
+		b, err := ioutil.ReadFile(*ldapBindPwFile)
+		if err != nil {
+			return nil, fmt.Errorf("ldap: unable to read ldap.bind-password-file: %s", err)
+		}
+		bindPassword = strings.TrimSpace(string(b))
+	}
+
+	return NewLDAPSource(LDAPOptions{
+		URL:          *ldapURL,
+		BindDN:       *ldapBindDN,
+		BindPassword: bindPassword,
+		StartTLS:     *ldapStartTLS,
+		TLSCAFile:    *ldapTLSCAFile,
+		TLSCertFile:  *ldapTLSCertFile,
+		TLSKeyFile:   *ldapTLSKeyFile,
+		Timeout:      *ldapTimeout,
+	})
+}
+
+//monitoredCounter describes a single numeric attribute read from one or
+//more entries under cn=Monitor.
+type monitoredCounter struct {
+	baseDN    string
+	attribute string
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+}
+
+var monitoredCounters = []monitoredCounter{
+	{
+		baseDN:    "cn=Current,cn=Connections," + monitorBaseDN,
+		attribute: "monitorCounter",
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "connections_current"),
+			"Current number of connections.",
+			nil, nil,
+		),
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		baseDN:    "cn=Total,cn=Connections," + monitorBaseDN,
+		attribute: "monitorCounter",
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "connections_total"),
+			"Total number of connections accepted since startup.",
+			nil, nil,
+		),
+		valueType: prometheus.CounterValue,
+	},
+	{
+		baseDN:    "cn=Bytes,cn=Statistics," + monitorBaseDN,
+		attribute: "monitorCounter",
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "bytes_total"),
+			"Total number of bytes sent to clients since startup.",
+			nil, nil,
+		),
+		valueType: prometheus.CounterValue,
+	},
+	{
+		baseDN:    "cn=Entries,cn=Statistics," + monitorBaseDN,
+		attribute: "monitorCounter",
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "entries_total"),
+			"Total number of entries sent to clients since startup.",
+			nil, nil,
+		),
+		valueType: prometheus.CounterValue,
+	},
+	{
+		baseDN:    "cn=Referrals,cn=Statistics," + monitorBaseDN,
+		attribute: "monitorCounter",
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "referrals_total"),
+			"Total number of referrals sent to clients since startup.",
+			nil, nil,
+		),
+		valueType: prometheus.CounterValue,
+	},
+	{
+		baseDN:    "cn=Read,cn=Waiters," + monitorBaseDN,
+		attribute: "monitorCounter",
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "waiters_read"),
+			"Current number of connections waiting to read.",
+			nil, nil,
+		),
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		baseDN:    "cn=Write,cn=Waiters," + monitorBaseDN,
+		attribute: "monitorCounter",
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "waiters_write"),
+			"Current number of connections waiting to write.",
+			nil, nil,
+		),
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		baseDN:    "cn=Open,cn=Threads," + monitorBaseDN,
+		attribute: "monitoredInfo",
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "threads_open"),
+			"Current number of open threads.",
+			nil, nil,
+		),
+		valueType: prometheus.GaugeValue,
+	},
+	{
+		baseDN:    "cn=Active,cn=Threads," + monitorBaseDN,
+		attribute: "monitoredInfo",
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "threads_active"),
+			"Current number of active threads.",
+			nil, nil,
+		),
+		valueType: prometheus.GaugeValue,
+	},
+}
+
+//monitoredOperations maps each cn=Operations,cn=Monitor child to the
+//operation name used to label the resulting metrics.
+var monitoredOperations = []string{
+	"Bind", "Unbind", "Search", "Compare", "Modify", "Modrdn",
+	"Add", "Delete", "Abandon", "Extended",
+}
+
+var (
+	operationsCompletedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "operations_completed_total"),
+		"Number of times an operation type has completed.",
+		[]string{"operation"}, nil,
+	)
+	operationsInitiatedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "operations_initiated_total"),
+		"Number of times an operation type has been initiated.",
+		[]string{"operation"}, nil,
+	)
+	databaseMDBPagesUsedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "database_mdb_pages_used"),
+		"Number of pages in use by the mdb database.",
+		[]string{"database"}, nil,
+	)
+)
+
+//Update implements the OpenLDAPSource interface.
+func (l *LDAPSource) Update(ch chan<- prometheus.Metric) error {
+	conn, err := l.dial()
+	if err != nil {
+		return fmt.Errorf("ldap: unable to connect: %s", err)
+	}
+	defer conn.Close()
+
+	if l.opts.BindDN != "" {
+		if err := conn.Bind(l.opts.BindDN, l.opts.BindPassword); err != nil {
+			return fmt.Errorf("ldap: bind failed: %s", err)
+		}
+	} else {
+		if err := conn.UnauthenticatedBind(""); err != nil {
+			return fmt.Errorf("ldap: anonymous bind failed: %s", err)
+		}
+	}
+
+	for _, m := range monitoredCounters {
+		value, err := l.readCounter(conn, m.baseDN, m.attribute)
+		if err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, value)
+	}
+
+	if err := l.collectOperations(conn, ch); err != nil {
+		return err
+	}
+	return l.collectDatabases(conn, ch)
+}
+
+//collectOperations reads cn=Operations,cn=Monitor and exports completed and
+//initiated counts per operation type.
+func (l *LDAPSource) collectOperations(conn *ldap.Conn, ch chan<- prometheus.Metric) error {
+	for _, op := range monitoredOperations {
+		baseDN := fmt.Sprintf("cn=%s,cn=Operations,%s", op, monitorBaseDN)
+		entry, err := l.readEntry(conn, baseDN, []string{"monitorOpCompleted", "monitorOpInitiated"})
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+		if v, ok := entryFloat(entry, "monitorOpCompleted"); ok {
+			ch <- prometheus.MustNewConstMetric(operationsCompletedDesc, prometheus.CounterValue, v, op)
+		}
+		if v, ok := entryFloat(entry, "monitorOpInitiated"); ok {
+			ch <- prometheus.MustNewConstMetric(operationsInitiatedDesc, prometheus.CounterValue, v, op)
+		}
+	}
+	return nil
+}
+
+//collectDatabases walks cn=Databases,cn=Monitor and exports the mdb page
+//usage of every backend that exposes it.
+func (l *LDAPSource) collectDatabases(conn *ldap.Conn, ch chan<- prometheus.Metric) error {
+	req := ldap.NewSearchRequest(
+		"cn=Databases,"+monitorBaseDN,
+		ldap.ScopeSingleLevel, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=monitoredObject)",
+		[]string{"namingContexts", "olmMDBPagesUsed"},
+		nil,
+	)
+	res, err := conn.Search(req)
+	if err != nil {
+		return fmt.Errorf("ldap: search of cn=Databases,%s failed: %s", monitorBaseDN, err)
+	}
+	for _, entry := range res.Entries {
+		pages, ok := entryFloat(entry, "olmMDBPagesUsed")
+		if !ok {
+			continue
+		}
+		database := entry.GetAttributeValue("namingContexts")
+		if database == "" {
+			database = entry.DN
+		}
+		ch <- prometheus.MustNewConstMetric(databaseMDBPagesUsedDesc, prometheus.GaugeValue, pages, database)
+	}
+	return nil
+}
+
+//readCounter fetches a single numeric attribute from baseDN.
+func (l *LDAPSource) readCounter(conn *ldap.Conn, baseDN, attribute string) (float64, error) {
+	entry, err := l.readEntry(conn, baseDN, []string{attribute})
+	if err != nil {
+		return 0, err
+	}
+	if entry == nil {
+		return 0, nil
+	}
+	v, _ := entryFloat(entry, attribute)
+	return v, nil
+}
+
+//readEntry performs a base-scope search for a single DN, returning nil if
+//it does not exist so that optional monitor entries can be skipped.
+func (l *LDAPSource) readEntry(conn *ldap.Conn, baseDN string, attributes []string) (*ldap.Entry, error) {
+	req := ldap.NewSearchRequest(
+		baseDN,
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		attributes,
+		nil,
+	)
+	res, err := conn.Search(req)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ldap: search of %s failed: %s", baseDN, err)
+	}
+	if len(res.Entries) == 0 {
+		return nil, nil
+	}
+	return res.Entries[0], nil
+}
+
+//entryFloat extracts and parses a numeric attribute value. monitorCounter
+//and similar attributes are stored as plain decimal strings; monitoredInfo
+//values occasionally carry text after the number, e.g. "12 active", so only
+//the first whitespace-separated field is parsed.
+func entryFloat(entry *ldap.Entry, attribute string) (float64, bool) {
+	raw := entry.GetAttributeValue(attribute)
+	if raw == "" {
+		return 0, false
+	}
+	raw = strings.Fields(raw)[0]
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+//dial opens a connection to opts.URL, optionally upgrading it with
+//StartTLS.
+func (l *LDAPSource) dial() (*ldap.Conn, error) {
+	tlsConfig, err := l.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ldap.DialURL(l.opts.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: l.opts.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(l.opts.Timeout)
+
+	if l.opts.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("starttls failed: %s", err)
+		}
+	}
+	return conn, nil
+}
+
+//tlsConfig builds the *tls.Config used for ldaps:// and StartTLS
+//connections from the configured CA/cert/key files.
+func (l *LDAPSource) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{}
+
+	if l.opts.TLSCAFile != "" {
+		caCert, err := ioutil.ReadFile(l.opts.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read tls-ca-file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("unable to parse tls-ca-file %q", l.opts.TLSCAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if l.opts.TLSCertFile != "" || l.opts.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(l.opts.TLSCertFile, l.opts.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load tls-cert-file/tls-key-file: %s", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
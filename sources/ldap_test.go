@@ -0,0 +1,62 @@
+package sources
+
+import (
+	"testing"
+
+	"gopkg.in/ldap.v3"
+)
+
+func TestEntryFloat(t *testing.T) {
+	cases := []struct {
+		name      string
+		attribute string
+		value     string
+		want      float64
+		wantOK    bool
+	}{
+		{
+			name:      "plain decimal string",
+			attribute: "monitorOpCompleted",
+			value:     "42",
+			want:      42,
+			wantOK:    true,
+		},
+		{
+			name:      "monitoredInfo-style prefix",
+			attribute: "monitorCurrentConnections",
+			value:     "12 active",
+			want:      12,
+			wantOK:    true,
+		},
+		{
+			name:      "attribute missing",
+			attribute: "monitorOpCompleted",
+			value:     "",
+			wantOK:    false,
+		},
+		{
+			name:      "non-numeric value",
+			attribute: "monitorOpCompleted",
+			value:     "not-a-number",
+			wantOK:    false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			attrs := map[string][]string{}
+			if tc.value != "" {
+				attrs[tc.attribute] = []string{tc.value}
+			}
+			entry := ldap.NewEntry(monitorBaseDN, attrs)
+
+			got, ok := entryFloat(entry, tc.attribute)
+			if ok != tc.wantOK {
+				t.Fatalf("entryFloat(%q) ok = %v, want %v", tc.value, ok, tc.wantOK)
+			}
+			if ok && got != tc.want {
+				t.Errorf("entryFloat(%q) = %v, want %v", tc.value, got, tc.want)
+			}
+		})
+	}
+}
@@ -8,7 +8,7 @@ import (
 const Namespace = "openldap"
 
 //Factories contains the list of all sources.
-var Factories = make(map[string]func() (LustreSource, error))
+var Factories = make(map[string]func() (OpenLDAPSource, error))
 
 //OpenLDAPSource is the interface that each source implements.
 type OpenLDAPSource interface {
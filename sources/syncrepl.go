@@ -0,0 +1,276 @@
+package sources
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/ldap.v3"
+)
+
+var (
+	syncreplProviderURL  = flag.String("syncrepl.provider-url", "", "URL of the provider (master) LDAP server.")
+	syncreplConsumerURLs = flag.String("syncrepl.consumer-urls", "", "Comma separated URLs of the consumer (replica) LDAP servers.")
+	syncreplSuffixes     = flag.String("syncrepl.suffixes", "", "Comma separated naming contexts to compare contextCSN for.")
+	syncreplBindDN       = flag.String("syncrepl.bind-dn", "", "DN to bind with on every server. Leave empty for an anonymous bind.")
+	syncreplBindPassword = flag.String("syncrepl.bind-password", "", "Password to bind with.")
+	syncreplBindPwFile   = flag.String("syncrepl.bind-password-file", "", "File containing the password to bind with. Takes precedence over syncrepl.bind-password.")
+	syncreplTimeout      = flag.Duration("syncrepl.timeout", 5*time.Second, "Timeout for LDAP connections and searches.")
+)
+
+func init() {
+	Factories["syncrepl"] = newSyncreplSourceFromFlags
+}
+
+var (
+	replicationContextCSNDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "replication", "contextcsn_timestamp_seconds"),
+		"Timestamp encoded in a server's contextCSN for a suffix and replication ID, in seconds since the epoch.",
+		[]string{"server", "suffix", "rid"}, nil,
+	)
+	replicationLagDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "replication", "lag_seconds"),
+		"Replication lag between a consumer and the provider for a suffix and replication ID, derived from contextCSN.",
+		[]string{"consumer", "provider", "suffix", "rid"}, nil,
+	)
+	syncreplScrapeErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "replication",
+			Name:      "scrape_error",
+			Help:      "Number of contextCSN scrape failures, by server.",
+		},
+		[]string{"server"},
+	)
+)
+
+//contextCSNPattern matches the OpenLDAP contextCSN syntax:
+//YYYYMMDDhhmmss.uuuuuuZ#ssss#rid#mod.
+var contextCSNPattern = regexp.MustCompile(`^(\d{14})\.(\d+)Z#([0-9a-fA-F]+)#([0-9a-fA-F]+)#([0-9a-fA-F]+)$`)
+
+//contextCSN is a single parsed value of the multi-valued contextCSN
+//attribute, one of which exists per replication ID (rid) contributing to a
+//suffix.
+type contextCSN struct {
+	timestamp time.Time
+	rid       string
+}
+
+//parseContextCSN parses a single contextCSN value.
+func parseContextCSN(raw string) (*contextCSN, error) {
+	m := contextCSNPattern.FindStringSubmatch(raw)
+	if m == nil {
+		return nil, fmt.Errorf("unrecognized contextCSN format %q", raw)
+	}
+
+	ts, err := time.ParseInLocation("20060102150405", m[1], time.UTC)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse contextCSN timestamp %q: %s", m[1], err)
+	}
+	micros, err := strconv.Atoi(m[2])
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse contextCSN fraction %q: %s", m[2], err)
+	}
+
+	return &contextCSN{timestamp: ts.Add(time.Duration(micros) * time.Microsecond), rid: m[4]}, nil
+}
+
+//findCSN returns the entry in csns whose rid matches, or nil.
+func findCSN(csns []*contextCSN, rid string) *contextCSN {
+	for _, c := range csns {
+		if c.rid == rid {
+			return c
+		}
+	}
+	return nil
+}
+
+//SyncreplOptions configures a SyncreplSource.
+type SyncreplOptions struct {
+	ProviderURL  string
+	ConsumerURLs []string
+	Suffixes     []string
+	BindDN       string
+	BindPassword string
+	Timeout      time.Duration
+}
+
+//SyncreplSource compares the contextCSN of a provider against one or more
+//consumers to derive OpenLDAP syncrepl replication lag. This is not
+//derivable from the procfs or cn=Monitor sources, which only see a single
+//server in isolation.
+type SyncreplSource struct {
+	opts SyncreplOptions
+}
+
+//NewSyncreplSource returns an OpenLDAPSource comparing opts.ProviderURL
+//against opts.ConsumerURLs for each of opts.Suffixes.
+func NewSyncreplSource(opts SyncreplOptions) (OpenLDAPSource, error) {
+	if opts.ProviderURL == "" {
+		return nil, fmt.Errorf("syncrepl: no provider URL configured")
+	}
+	if len(opts.ConsumerURLs) == 0 {
+		return nil, fmt.Errorf("syncrepl: no consumer URLs configured")
+	}
+	if len(opts.Suffixes) == 0 {
+		return nil, fmt.Errorf("syncrepl: no suffixes configured")
+	}
+	return &SyncreplSource{opts: opts}, nil
+}
+
+//newSyncreplSourceFromFlags builds a SyncreplSource from the syncrepl.*
+//flags. It backs the "syncrepl" entry in Factories so the collector can be
+//enabled with --collector.syncrepl once the required flags are set.
+func newSyncreplSourceFromFlags() (OpenLDAPSource, error) {
+	bindPassword := *syncreplBindPassword
+	if *syncreplBindPwFile != "" {
+		b, err := ioutil.ReadFile(*syncreplBindPwFile)
+		if err != nil {
+			return nil, fmt.Errorf("syncrepl: unable to read syncrepl.bind-password-file: %s", err)
+		}
+		bindPassword = strings.TrimSpace(string(b))
+	}
+
+	return NewSyncreplSource(SyncreplOptions{
+		ProviderURL:  *syncreplProviderURL,
+		ConsumerURLs: splitAndTrim(*syncreplConsumerURLs),
+		Suffixes:     splitAndTrim(*syncreplSuffixes),
+		BindDN:       *syncreplBindDN,
+		BindPassword: bindPassword,
+		Timeout:      *syncreplTimeout,
+	})
+}
+
+func splitAndTrim(s string) []string {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+//Update implements the OpenLDAPSource interface.
+func (s *SyncreplSource) Update(ch chan<- prometheus.Metric) error {
+	providerCSNs, providerErr := s.collectServer(s.opts.ProviderURL, ch)
+	if providerErr != nil {
+		syncreplScrapeErrors.WithLabelValues(s.opts.ProviderURL).Inc()
+	}
+
+	var lastErr error
+	for _, consumerURL := range s.opts.ConsumerURLs {
+		consumerCSNs, err := s.collectServer(consumerURL, ch)
+		if err != nil {
+			syncreplScrapeErrors.WithLabelValues(consumerURL).Inc()
+			lastErr = err
+		}
+		if providerCSNs == nil || consumerCSNs == nil {
+			continue
+		}
+
+		for suffix, csns := range consumerCSNs {
+			for _, consumerCSN := range csns {
+				providerCSN := findCSN(providerCSNs[suffix], consumerCSN.rid)
+				if providerCSN == nil {
+					continue
+				}
+				lag := providerCSN.timestamp.Sub(consumerCSN.timestamp).Seconds()
+				ch <- prometheus.MustNewConstMetric(replicationLagDesc, prometheus.GaugeValue, lag,
+					consumerURL, s.opts.ProviderURL, suffix, consumerCSN.rid)
+			}
+		}
+	}
+
+	syncreplScrapeErrors.Collect(ch)
+	if providerErr != nil {
+		return providerErr
+	}
+	return lastErr
+}
+
+//collectServer binds to url and reads the contextCSN of every configured
+//suffix, emitting a contextcsn_timestamp_seconds metric for each value
+//found and returning them keyed by suffix for lag computation.
+func (s *SyncreplSource) collectServer(url string, ch chan<- prometheus.Metric) (map[string][]*contextCSN, error) {
+	conn, err := ldap.DialURL(url, ldap.DialWithDialer(&net.Dialer{Timeout: s.opts.Timeout}))
+	if err != nil {
+		return nil, fmt.Errorf("syncrepl: unable to connect to %s: %s", url, err)
+	}
+	defer conn.Close()
+	conn.SetTimeout(s.opts.Timeout)
+
+	if s.opts.BindDN != "" {
+		err = conn.Bind(s.opts.BindDN, s.opts.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("syncrepl: bind to %s failed: %s", url, err)
+	}
+
+	result := make(map[string][]*contextCSN, len(s.opts.Suffixes))
+	var errs []string
+	for _, suffix := range s.opts.Suffixes {
+		csns, err := fetchContextCSNs(conn, suffix)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		result[suffix] = csns
+		for _, csn := range csns {
+			ch <- prometheus.MustNewConstMetric(
+				replicationContextCSNDesc, prometheus.GaugeValue,
+				float64(csn.timestamp.UnixNano())/1e9,
+				url, suffix, csn.rid,
+			)
+		}
+	}
+
+	// A suffix-level failure shouldn't discard the suffixes that did
+	// succeed, so the error is reported alongside the partial result
+	// rather than in place of it.
+	if len(errs) > 0 {
+		return result, fmt.Errorf("syncrepl: %s: %s", url, strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+//fetchContextCSNs reads and parses every contextCSN value on suffix.
+func fetchContextCSNs(conn *ldap.Conn, suffix string) ([]*contextCSN, error) {
+	req := ldap.NewSearchRequest(
+		suffix,
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"contextCSN"},
+		nil,
+	)
+	res, err := conn.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("search of %q failed: %s", suffix, err)
+	}
+	if len(res.Entries) == 0 {
+		return nil, fmt.Errorf("no such suffix %q", suffix)
+	}
+
+	raw := res.Entries[0].GetAttributeValues("contextCSN")
+	csns := make([]*contextCSN, 0, len(raw))
+	for _, v := range raw {
+		csn, err := parseContextCSN(v)
+		if err != nil {
+			return nil, err
+		}
+		csns = append(csns, csn)
+	}
+	return csns, nil
+}
@@ -0,0 +1,59 @@
+package sources
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseContextCSN(t *testing.T) {
+	cases := []struct {
+		name    string
+		raw     string
+		wantTS  time.Time
+		wantRID string
+		wantErr bool
+	}{
+		{
+			name:    "valid value",
+			raw:     "20230615120000.123456Z#000000#001#000000",
+			wantTS:  time.Date(2023, 6, 15, 12, 0, 0, 123456000, time.UTC),
+			wantRID: "001",
+		},
+		{
+			name:    "rid picked from the correct field",
+			raw:     "20230615120000.123456Z#000000#00a#000001",
+			wantRID: "00a",
+		},
+		{
+			name:    "malformed",
+			raw:     "not-a-contextCSN",
+			wantErr: true,
+		},
+		{
+			name:    "short, missing trailing fields",
+			raw:     "20230615120000.123456Z#000000",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			csn, err := parseContextCSN(tc.raw)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseContextCSN(%q): expected error, got none", tc.raw)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseContextCSN(%q): unexpected error: %s", tc.raw, err)
+			}
+			if csn.rid != tc.wantRID {
+				t.Errorf("parseContextCSN(%q).rid = %q, want %q", tc.raw, csn.rid, tc.wantRID)
+			}
+			if !tc.wantTS.IsZero() && !csn.timestamp.Equal(tc.wantTS) {
+				t.Errorf("parseContextCSN(%q).timestamp = %s, want %s", tc.raw, csn.timestamp, tc.wantTS)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//webConfig describes --web.config.file: TLS (optionally mTLS) for the
+//exporter's own HTTP endpoint, plus a set of HTTP basic-auth users. It
+//follows the shape of the Prometheus exporter-toolkit web config.
+type webConfig struct {
+	TLSServerConfig *webTLSServerConfig `yaml:"tls_server_config"`
+	BasicAuthUsers  map[string]string   `yaml:"basic_auth_users"`
+}
+
+//webTLSServerConfig configures the exporter's listener. ClientCAFile, when
+//set, enables mTLS by requiring and verifying a client certificate.
+type webTLSServerConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+//loadWebConfig reads path, or returns (nil, nil) when path is empty so
+//callers fall back to plain, unauthenticated HTTP.
+func loadWebConfig(path string) (*webConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read web.config.file: %s", err)
+	}
+
+	cfg := &webConfig{}
+	if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse web.config.file: %s", err)
+	}
+	return cfg, nil
+}
+
+//tlsConfig builds the server-side *tls.Config described by c, or nil if c
+//is nil or has no cert configured, meaning the listener stays plaintext.
+func (c *webTLSServerConfig) tlsConfig() (*tls.Config, error) {
+	if c == nil || c.CertFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load tls_server_config cert_file/key_file: %s", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if c.ClientCAFile != "" {
+		caCert, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read tls_server_config client_ca_file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("unable to parse tls_server_config client_ca_file %q", c.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+//basicAuth wraps next with HTTP basic auth checked against bcrypt-hashed
+//passwords. It is a no-op when users is empty, so a web.config.file with
+//only a tls_server_config section adds no authentication.
+func basicAuth(next http.Handler, users map[string]string) http.Handler {
+	if len(users) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		hash, known := users[user]
+		if !ok || !known || bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="openldap_exporter"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}